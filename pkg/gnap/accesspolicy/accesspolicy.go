@@ -0,0 +1,34 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package accesspolicy decides whether a requested grant may be issued.
+package accesspolicy
+
+import (
+	"errors"
+
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+// AccessPolicy evaluates the access rights requested in a GNAP request
+// against this server's policy.
+type AccessPolicy struct{}
+
+// Valid returns an error if req does not request any access this server is
+// willing to grant.
+func (ap *AccessPolicy) Valid(req *gnap.AuthRequest) error {
+	if req == nil || len(req.AccessToken) == 0 {
+		return errors.New("no access token requested")
+	}
+
+	for _, tr := range req.AccessToken {
+		if len(tr.Access) == 0 {
+			return errors.New("access token request has no access rights")
+		}
+	}
+
+	return nil
+}
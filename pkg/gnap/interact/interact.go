@@ -0,0 +1,23 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package interact defines the interface implemented by this server's
+// supported GNAP interaction modes (eg. redirect, user_code).
+package interact
+
+import "github.com/trustbloc/auth/spi/gnap"
+
+// Handler prepares the `interact` section of a grant response for a single
+// interaction mode and serves whatever HTTP endpoints that mode requires.
+type Handler interface {
+	// Mode returns the GNAP `start` mode this handler implements (eg.
+	// "redirect", "user_code").
+	Mode() string
+
+	// PrepareInteraction returns the interact response finish data for the
+	// given request interaction.
+	PrepareInteraction(interactRef string, interact *gnap.RequestInteract) (*gnap.ResponseInteract, error)
+}
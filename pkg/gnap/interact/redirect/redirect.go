@@ -0,0 +1,46 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package redirect implements the GNAP `redirect` interaction start mode:
+// the client is handed a URI to redirect the end user's browser to.
+package redirect
+
+import (
+	"errors"
+
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+const mode = "redirect"
+
+// Handler is an interact.Handler that points the end user at this server's
+// interaction endpoint via an HTTP redirect.
+type Handler struct {
+	interactURI string
+}
+
+// New returns a Handler that redirects end users to interactURI.
+func New(interactURI string) (*Handler, error) {
+	if interactURI == "" {
+		return nil, errors.New("interact uri is required")
+	}
+
+	return &Handler{interactURI: interactURI}, nil
+}
+
+// Mode returns "redirect".
+func (h *Handler) Mode() string {
+	return mode
+}
+
+// PrepareInteraction returns the interact response redirect URI for the
+// given interaction request.
+func (h *Handler) PrepareInteraction(interactRef string, _ *gnap.RequestInteract) (*gnap.ResponseInteract, error) {
+	return &gnap.ResponseInteract{
+		Redirect: h.interactURI,
+		Finish:   interactRef,
+	}, nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package usercode implements the GNAP `user_code` interaction start mode:
+// the end user is given a short, human-typable code to enter at a
+// verification URI (eg. on a second device), rather than being redirected
+// directly.
+package usercode
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+const mode = "user_code"
+
+const (
+	codeAlphabet    = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // excludes easily-confused characters
+	codeLength      = 8
+	codeGenAttempts = 10
+)
+
+// Errors returned by Handler.
+var (
+	ErrCodeNotFound  = errors.New("user code not found")
+	ErrCodeExpired   = errors.New("user code expired")
+	ErrCodeRedeemed  = errors.New("user code already redeemed")
+	ErrCodeGenFailed = errors.New("failed to generate a unique user code")
+)
+
+// PendingGrant tracks a single user_code interaction from issuance through
+// redemption.
+type PendingGrant struct {
+	InteractRef string
+	ExpiresAt   time.Time
+	Redeemed    bool
+	Subject     string
+}
+
+// Handler is an interact.Handler that issues a user_code/verification URI
+// pair and tracks pending grants until the end user redeems their code.
+type Handler struct {
+	verificationURI string
+	ttl             time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*PendingGrant // code -> pending grant
+}
+
+// New returns a Handler that directs end users to verificationURI and
+// expires unredeemed codes after ttl.
+func New(verificationURI string, ttl time.Duration) (*Handler, error) {
+	if verificationURI == "" {
+		return nil, errors.New("verification uri is required")
+	}
+
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+
+	return &Handler{
+		verificationURI: verificationURI,
+		ttl:             ttl,
+		pending:         map[string]*PendingGrant{},
+	}, nil
+}
+
+// Mode returns "user_code".
+func (h *Handler) Mode() string {
+	return mode
+}
+
+// PrepareInteraction issues a fresh user code bound to interactRef and
+// returns it, along with the verification URI, for the grant response.
+func (h *Handler) PrepareInteraction(interactRef string, _ *gnap.RequestInteract) (*gnap.ResponseInteract, error) {
+	code, err := h.newCode()
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.pending[code] = &PendingGrant{
+		InteractRef: interactRef,
+		ExpiresAt:   time.Now().Add(h.ttl),
+	}
+	h.mu.Unlock()
+
+	return &gnap.ResponseInteract{
+		UserCode: &gnap.UserCodeInteract{Code: code, URI: h.verificationURI},
+		Finish:   interactRef,
+	}, nil
+}
+
+// Submit redeems code on behalf of subject, the identifier of the end
+// user's already-authenticated session. It fails if code is unknown,
+// expired, or already redeemed.
+func (h *Handler) Submit(code, subject string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pg, ok := h.pending[code]
+	if !ok {
+		return ErrCodeNotFound
+	}
+
+	if time.Now().After(pg.ExpiresAt) {
+		delete(h.pending, code)
+
+		return ErrCodeExpired
+	}
+
+	if pg.Redeemed {
+		return ErrCodeRedeemed
+	}
+
+	pg.Redeemed = true
+	pg.Subject = subject
+
+	return nil
+}
+
+// LookupByInteractRef returns the pending grant issued for interactRef, if
+// any, so a continuation request can learn whether its code has been
+// redeemed.
+func (h *Handler) LookupByInteractRef(interactRef string) (*PendingGrant, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, pg := range h.pending {
+		if pg.InteractRef == interactRef {
+			if time.Now().After(pg.ExpiresAt) {
+				return nil, false
+			}
+
+			copied := *pg
+
+			return &copied, true
+		}
+	}
+
+	return nil, false
+}
+
+func (h *Handler) newCode() (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := 0; i < codeGenAttempts; i++ {
+		code, err := randomCode()
+		if err != nil {
+			return "", err
+		}
+
+		if _, exists := h.pending[code]; !exists {
+			return code, nil
+		}
+	}
+
+	return "", ErrCodeGenFailed
+}
+
+func randomCode() (string, error) {
+	raw := make([]byte, codeLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	out := make([]byte, codeLength)
+	for i, b := range raw {
+		out[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+
+	return fmt.Sprintf("%s-%s", out[:4], out[4:]), nil
+}
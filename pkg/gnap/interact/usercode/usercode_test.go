@@ -0,0 +1,141 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package usercode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		h, err := New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+		require.NotNil(t, h)
+	})
+
+	t.Run("requires a verification uri", func(t *testing.T) {
+		h, err := New("", time.Minute)
+		require.Error(t, err)
+		require.Nil(t, h)
+	})
+
+	t.Run("requires a positive ttl", func(t *testing.T) {
+		h, err := New("https://as.example/device", 0)
+		require.Error(t, err)
+		require.Nil(t, h)
+	})
+}
+
+func TestHandler_Mode(t *testing.T) {
+	h, err := New("https://as.example/device", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, "user_code", h.Mode())
+}
+
+func TestHandler_PrepareInteraction(t *testing.T) {
+	h, err := New("https://as.example/device", time.Minute)
+	require.NoError(t, err)
+
+	resp, err := h.PrepareInteraction("ref-1", nil)
+	require.NoError(t, err)
+	require.NotNil(t, resp.UserCode)
+	require.NotEmpty(t, resp.UserCode.Code)
+	require.Equal(t, "https://as.example/device", resp.UserCode.URI)
+	require.Equal(t, "ref-1", resp.Finish)
+}
+
+func TestHandler_newCode_collision(t *testing.T) {
+	h, err := New("https://as.example/device", time.Minute)
+	require.NoError(t, err)
+
+	// Pre-populate pending with codeGenAttempts-1 random codes, then check
+	// that newCode returns a code not already pending. The code space
+	// (32^8) is large, so these entries almost never collide with a
+	// generated code and the retry loop is not forced to run.
+	for i := 0; i < codeGenAttempts-1; i++ {
+		code, genErr := randomCode()
+		require.NoError(t, genErr)
+		h.pending[code] = &PendingGrant{}
+	}
+
+	code, err := h.newCode()
+	require.NoError(t, err)
+	require.NotContains(t, h.pending, code)
+}
+
+func TestHandler_Submit(t *testing.T) {
+	t.Run("successful redemption", func(t *testing.T) {
+		h, err := New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		resp, err := h.PrepareInteraction("ref-1", nil)
+		require.NoError(t, err)
+
+		require.NoError(t, h.Submit(resp.UserCode.Code, "user-1"))
+
+		pg, ok := h.LookupByInteractRef("ref-1")
+		require.True(t, ok)
+		require.True(t, pg.Redeemed)
+		require.Equal(t, "user-1", pg.Subject)
+	})
+
+	t.Run("unknown code", func(t *testing.T) {
+		h, err := New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		require.ErrorIs(t, h.Submit("NOPE-0000", "user-1"), ErrCodeNotFound)
+	})
+
+	t.Run("already redeemed code is rejected", func(t *testing.T) {
+		h, err := New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		resp, err := h.PrepareInteraction("ref-1", nil)
+		require.NoError(t, err)
+
+		require.NoError(t, h.Submit(resp.UserCode.Code, "user-1"))
+		require.ErrorIs(t, h.Submit(resp.UserCode.Code, "user-2"), ErrCodeRedeemed)
+	})
+
+	t.Run("expired code is rejected", func(t *testing.T) {
+		h, err := New("https://as.example/device", time.Nanosecond)
+		require.NoError(t, err)
+
+		resp, err := h.PrepareInteraction("ref-1", nil)
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond)
+
+		require.ErrorIs(t, h.Submit(resp.UserCode.Code, "user-1"), ErrCodeExpired)
+	})
+}
+
+func TestHandler_LookupByInteractRef(t *testing.T) {
+	t.Run("not found", func(t *testing.T) {
+		h, err := New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		_, ok := h.LookupByInteractRef("nope")
+		require.False(t, ok)
+	})
+
+	t.Run("expired entries are hidden", func(t *testing.T) {
+		h, err := New("https://as.example/device", time.Nanosecond)
+		require.NoError(t, err)
+
+		_, err = h.PrepareInteraction("ref-1", nil)
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond)
+
+		_, ok := h.LookupByInteractRef("ref-1")
+		require.False(t, ok)
+	})
+}
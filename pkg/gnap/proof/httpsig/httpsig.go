@@ -0,0 +1,356 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package httpsig implements RFC 9421 (HTTP Message Signatures) as a GNAP
+// key proofing method: the client signs a canonicalized subset of the
+// request with the private key bound to its GNAP client instance, and this
+// package verifies that signature against the corresponding public JWK.
+package httpsig
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+// ProofType is the GNAP `proof` value this package handles.
+const ProofType = "httpsig"
+
+// requiredCovered are the components every signature must cover, regardless
+// of what else the client's Signature-Input claims. "authorization" is not
+// listed here because the initial grant request has no Authorization header
+// to cover; Verify adds it to this baseline whenever the request does carry
+// one, so a token presented alongside a signature is always bound to it.
+var requiredCovered = []string{"@method", "@target-uri", "@authority", "content-digest"}
+
+// maxSignatureAge bounds how old a signature's "created" parameter may be,
+// so a request signature captured in transit (eg. by a logging proxy)
+// cannot be replayed indefinitely.
+const maxSignatureAge = 5 * time.Minute
+
+// maxClockSkew bounds how far in the future a signature's "created"
+// parameter may be, tolerating reasonable clock drift between client and
+// server.
+const maxClockSkew = time.Minute
+
+// Verifier verifies RFC 9421 HTTP message signatures.
+type Verifier struct{}
+
+// New returns an httpsig Verifier.
+func New() *Verifier {
+	return &Verifier{}
+}
+
+// Verify reconstructs the RFC 9421 signature base for r, using the
+// components listed in its Signature-Input header, and checks it against
+// the `Signature` header using key. It also confirms the `Content-Digest`
+// header matches body.
+func (v *Verifier) Verify(r *http.Request, body []byte, key *gnap.Key) error {
+	if key == nil {
+		return errors.New("httpsig: no key to verify against")
+	}
+
+	if err := verifyContentDigest(r, body); err != nil {
+		return fmt.Errorf("httpsig: %w", err)
+	}
+
+	components, params, err := parseSignatureInput(r.Header.Get("Signature-Input"))
+	if err != nil {
+		return fmt.Errorf("httpsig: %w", err)
+	}
+
+	required := requiredCovered
+	if r.Header.Get("Authorization") != "" {
+		required = append(append([]string{}, required...), "authorization")
+	}
+
+	if err := requireComponents(components, required); err != nil {
+		return fmt.Errorf("httpsig: %w", err)
+	}
+
+	if err := checkFreshness(params); err != nil {
+		return fmt.Errorf("httpsig: %w", err)
+	}
+
+	base := signatureBase(r, components, params)
+
+	sig, err := parseSignature(r.Header.Get("Signature"))
+	if err != nil {
+		return fmt.Errorf("httpsig: %w", err)
+	}
+
+	if err := verifySignature(key.JWK, base, sig); err != nil {
+		return fmt.Errorf("httpsig: %w", err)
+	}
+
+	return nil
+}
+
+func verifyContentDigest(r *http.Request, body []byte) error {
+	digestHeader := r.Header.Get("Content-Digest")
+	if digestHeader == "" {
+		return errors.New("missing Content-Digest header")
+	}
+
+	sum := sha256.Sum256(body)
+	want := fmt.Sprintf("sha-256=:%s:", base64.StdEncoding.EncodeToString(sum[:]))
+
+	if digestHeader != want {
+		return errors.New("Content-Digest does not match body")
+	}
+
+	return nil
+}
+
+// signatureBase reconstructs the RFC 9421 signature base string over
+// components, the covered component list the request's Signature-Input
+// header claims to sign, echoing back its signature parameters (params,
+// including the leading ";") verbatim so the base matches what the client
+// signed.
+func signatureBase(r *http.Request, components []string, params string) string {
+	lines := make([]string, 0, len(components)+1)
+
+	for _, c := range components {
+		lines = append(lines, fmt.Sprintf(`"%s": %s`, c, componentValue(r, c)))
+	}
+
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = `"` + c + `"`
+	}
+
+	lines = append(lines, fmt.Sprintf(`"@signature-params": (%s)%s`, strings.Join(quoted, " "), params))
+
+	return strings.Join(lines, "\n")
+}
+
+// parseSignatureInput parses the request's Signature-Input header, for
+// signature label "sig1", into the ordered list of component identifiers it
+// claims to cover and its raw signature parameters string (eg.
+// `;created=1618884475;keyid="test-key"`, including the leading ";", or ""
+// if it has none).
+func parseSignatureInput(header string) ([]string, string, error) {
+	const label = "sig1="
+
+	if !strings.HasPrefix(header, label) {
+		return nil, "", errors.New("missing or malformed Signature-Input header")
+	}
+
+	list := strings.TrimPrefix(header, label)
+
+	start := strings.IndexByte(list, '(')
+	end := strings.IndexByte(list, ')')
+
+	if start < 0 || end <= start {
+		return nil, "", errors.New("missing or malformed Signature-Input header")
+	}
+
+	fields := strings.Fields(list[start+1 : end])
+	components := make([]string, 0, len(fields))
+
+	for _, f := range fields {
+		components = append(components, strings.Trim(f, `"`))
+	}
+
+	return components, list[end+1:], nil
+}
+
+// checkFreshness requires params to declare a "created" timestamp within
+// maxSignatureAge of now (allowing up to maxClockSkew of client/server
+// drift), and, if it declares "expires", that it has not yet passed —
+// binding the signature to a narrow time window so a captured request
+// cannot be replayed indefinitely.
+func checkFreshness(params string) error {
+	created, ok, err := sigParamInt(params, "created")
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("missing created signature parameter")
+	}
+
+	age := time.Since(time.Unix(created, 0))
+
+	if age > maxSignatureAge {
+		return errors.New("signature created timestamp is too old")
+	}
+
+	if age < -maxClockSkew {
+		return errors.New("signature created timestamp is too far in the future")
+	}
+
+	expires, ok, err := sigParamInt(params, "expires")
+	if err != nil {
+		return err
+	}
+
+	if ok && time.Now().After(time.Unix(expires, 0)) {
+		return errors.New("signature has expired")
+	}
+
+	return nil
+}
+
+// sigParamInt returns the integer value of name in params, the raw
+// Signature-Input parameters string (eg. `;created=123;expires=456`).
+func sigParamInt(params, name string) (int64, bool, error) {
+	for _, part := range strings.Split(params, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[0] != name {
+			continue
+		}
+
+		v, err := strconv.ParseInt(strings.Trim(kv[1], `"`), 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("malformed %q signature parameter", name)
+		}
+
+		return v, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// requireComponents confirms components contains every entry in required.
+func requireComponents(components, required []string) error {
+	have := make(map[string]struct{}, len(components))
+	for _, c := range components {
+		have[c] = struct{}{}
+	}
+
+	for _, want := range required {
+		if _, ok := have[want]; !ok {
+			return fmt.Errorf("signature does not cover required component %q", want)
+		}
+	}
+
+	return nil
+}
+
+func componentValue(r *http.Request, component string) string {
+	switch component {
+	case "@method":
+		return r.Method
+	case "@target-uri":
+		return targetURI(r)
+	case "@authority":
+		return r.Host
+	default:
+		return r.Header.Get(component)
+	}
+}
+
+// targetURI reconstructs the absolute URI of r per RFC 9421 §2.2.2. On a
+// server-received request, r.URL is path-only (no scheme or host), unlike
+// the absolute URI the client signed, so it must be rebuilt from the
+// request's scheme, Host header, and request-target before being covered
+// by the signature base.
+func targetURI(r *http.Request) string {
+	scheme := "http"
+
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// parseSignature extracts the raw signature bytes from a `Signature: sig1=:<base64>:`
+// header value.
+func parseSignature(header string) ([]byte, error) {
+	start := strings.IndexByte(header, ':')
+	end := strings.LastIndexByte(header, ':')
+
+	if start < 0 || end <= start {
+		return nil, errors.New("missing Signature header")
+	}
+
+	return base64.StdEncoding.DecodeString(header[start+1 : end])
+}
+
+func verifySignature(jwk map[string]interface{}, base string, sig []byte) error {
+	kty, _ := jwk["kty"].(string)
+
+	switch kty {
+	case "OKP":
+		return verifyEd25519(jwk, base, sig)
+	case "EC":
+		return verifyECDSA(jwk, base, sig)
+	default:
+		return fmt.Errorf("unsupported key type %q", kty)
+	}
+}
+
+func verifyEd25519(jwk map[string]interface{}, base string, sig []byte) error {
+	x, err := jwkBytes(jwk, "x")
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(x), []byte(base), sig) {
+		return errors.New("signature verification failed")
+	}
+
+	return nil
+}
+
+func verifyECDSA(jwk map[string]interface{}, base string, sig []byte) error {
+	x, err := jwkBytes(jwk, "x")
+	if err != nil {
+		return err
+	}
+
+	y, err := jwkBytes(jwk, "y")
+	if err != nil {
+		return err
+	}
+
+	if len(sig) != 64 {
+		return errors.New("malformed ecdsa signature")
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+
+	hash := sha256.Sum256([]byte(base))
+
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+
+	if !ecdsa.Verify(pub, hash[:], r, s) {
+		return errors.New("signature verification failed")
+	}
+
+	return nil
+}
+
+func jwkBytes(jwk map[string]interface{}, field string) ([]byte, error) {
+	v, ok := jwk[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("jwk missing %q", field)
+	}
+
+	return base64.RawURLEncoding.DecodeString(v)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package httpsig
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+// signedRequest builds a request signed the way a continuation request is:
+// carrying an Authorization header that gets covered by the signature.
+func signedRequest(t *testing.T, body []byte, sign func(base string) []byte) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "https://as.example/gnap/auth", nil)
+	req.Host = "as.example"
+	req.Header.Set("Authorization", "GNAP sometoken")
+
+	return signRequest(req, body, []string{"@method", "@target-uri", "@authority", "content-digest", "authorization"}, sign)
+}
+
+// signRequest sets req's Content-Digest, Signature-Input (listing
+// components and a fresh "created" parameter), and Signature headers,
+// signing the resulting base with sign.
+func signRequest(req *http.Request, body []byte, components []string, sign func(base string) []byte) *http.Request {
+	return signRequestWithParams(req, body, components, fmt.Sprintf(";created=%d", time.Now().Unix()), sign)
+}
+
+// signRequestWithParams is signRequest but lets the caller control the raw
+// signature parameters string (eg. to omit "created" or backdate it).
+func signRequestWithParams(
+	req *http.Request, body []byte, components []string, params string, sign func(base string) []byte,
+) *http.Request {
+	sum := sha256.Sum256(body)
+	req.Header.Set("Content-Digest", fmt.Sprintf("sha-256=:%s:", base64.StdEncoding.EncodeToString(sum[:])))
+
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = `"` + c + `"`
+	}
+
+	req.Header.Set("Signature-Input", "sig1=("+strings.Join(quoted, " ")+")"+params)
+
+	base := signatureBase(req, components, params)
+	sig := sign(base)
+	req.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(sig)+":")
+
+	return req
+}
+
+func TestVerifier_Verify_Ed25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key := &gnap.Key{
+		Proof: ProofType,
+		JWK: map[string]interface{}{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(pub),
+		},
+	}
+
+	body := []byte(`{"access_token":[{"access":[{"type":"vc-issuer"}]}]}`)
+
+	req := signedRequest(t, body, func(base string) []byte {
+		return ed25519.Sign(priv, []byte(base))
+	})
+
+	require.NoError(t, New().Verify(req, body, key))
+}
+
+func TestVerifier_Verify_ECDSA(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	key := &gnap.Key{
+		Proof: ProofType,
+		JWK: map[string]interface{}{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(priv.X.Bytes()),
+			"y":   base64.RawURLEncoding.EncodeToString(priv.Y.Bytes()),
+		},
+	}
+
+	body := []byte(`{"access_token":[{"access":[{"type":"vc-issuer"}]}]}`)
+
+	req := signedRequest(t, body, func(base string) []byte {
+		hash := sha256.Sum256([]byte(base))
+
+		r, s, signErr := ecdsa.Sign(rand.Reader, priv, hash[:])
+		require.NoError(t, signErr)
+
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+
+		return sig
+	})
+
+	require.NoError(t, New().Verify(req, body, key))
+}
+
+func TestVerifier_Verify_errors(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key := &gnap.Key{
+		Proof: ProofType,
+		JWK: map[string]interface{}{
+			"kty": "OKP",
+			"x":   base64.RawURLEncoding.EncodeToString(pub),
+		},
+	}
+
+	body := []byte(`{}`)
+
+	t.Run("missing key", func(t *testing.T) {
+		req := signedRequest(t, body, func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+		require.Error(t, New().Verify(req, body, nil))
+	})
+
+	t.Run("content digest mismatch", func(t *testing.T) {
+		req := signedRequest(t, body, func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+		require.Error(t, New().Verify(req, []byte(`{"tampered":true}`), key))
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		req := signedRequest(t, body, func(base string) []byte { return []byte("not-a-signature") })
+		require.Error(t, New().Verify(req, body, key))
+	})
+
+	t.Run("unsupported key type", func(t *testing.T) {
+		badKey := &gnap.Key{Proof: ProofType, JWK: map[string]interface{}{"kty": "RSA"}}
+		req := signedRequest(t, body, func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+		require.Error(t, New().Verify(req, body, badKey))
+	})
+
+	t.Run("missing Signature-Input header", func(t *testing.T) {
+		req := signedRequest(t, body, func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+		req.Header.Del("Signature-Input")
+		require.Error(t, New().Verify(req, body, key))
+	})
+
+	t.Run("signature does not cover a required component", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://as.example/gnap/auth", nil)
+		req.Host = "as.example"
+
+		req = signRequest(req, body, []string{"@method", "content-digest"},
+			func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+
+		require.Error(t, New().Verify(req, body, key))
+	})
+
+	t.Run("request carries Authorization but signature does not cover it", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://as.example/gnap/continue", nil)
+		req.Host = "as.example"
+		req.Header.Set("Authorization", "GNAP sometoken")
+
+		req = signRequest(req, body, []string{"@method", "@target-uri", "@authority", "content-digest"},
+			func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+
+		require.Error(t, New().Verify(req, body, key))
+	})
+
+	t.Run("missing created signature parameter is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://as.example/gnap/auth", nil)
+		req.Host = "as.example"
+
+		req = signRequestWithParams(req, body, []string{"@method", "@target-uri", "@authority", "content-digest"}, "",
+			func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+
+		require.Error(t, New().Verify(req, body, key))
+	})
+
+	t.Run("signature created too long ago is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://as.example/gnap/auth", nil)
+		req.Host = "as.example"
+
+		params := fmt.Sprintf(";created=%d", time.Now().Add(-time.Hour).Unix())
+
+		req = signRequestWithParams(req, body, []string{"@method", "@target-uri", "@authority", "content-digest"},
+			params, func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+
+		require.Error(t, New().Verify(req, body, key))
+	})
+
+	t.Run("signature created too far in the future is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://as.example/gnap/auth", nil)
+		req.Host = "as.example"
+
+		params := fmt.Sprintf(";created=%d", time.Now().Add(time.Hour).Unix())
+
+		req = signRequestWithParams(req, body, []string{"@method", "@target-uri", "@authority", "content-digest"},
+			params, func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+
+		require.Error(t, New().Verify(req, body, key))
+	})
+
+	t.Run("expired signature is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://as.example/gnap/auth", nil)
+		req.Host = "as.example"
+
+		now := time.Now()
+		params := fmt.Sprintf(";created=%d;expires=%d", now.Add(-time.Minute).Unix(), now.Add(-time.Second).Unix())
+
+		req = signRequestWithParams(req, body, []string{"@method", "@target-uri", "@authority", "content-digest"},
+			params, func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+
+		require.Error(t, New().Verify(req, body, key))
+	})
+}
+
+// TestVerifier_Verify_noAuthorizationHeader covers the initial grant
+// request, which carries no Authorization header, so a compliant client's
+// Signature-Input never lists "authorization" for it.
+func TestVerifier_Verify_noAuthorizationHeader(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key := &gnap.Key{
+		Proof: ProofType,
+		JWK: map[string]interface{}{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(pub),
+		},
+	}
+
+	body := []byte(`{"access_token":[{"access":[{"type":"vc-issuer"}]}]}`)
+
+	req := httptest.NewRequest(http.MethodPost, "https://as.example/gnap/auth", nil)
+	req.Host = "as.example"
+
+	req = signRequest(req, body, []string{"@method", "@target-uri", "@authority", "content-digest"},
+		func(base string) []byte { return ed25519.Sign(priv, []byte(base)) })
+
+	require.NoError(t, New().Verify(req, body, key))
+}
@@ -0,0 +1,24 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package proof defines the interface implemented by this server's
+// supported GNAP key proofing methods (eg. httpsig, jwsd, dpop, mtls).
+package proof
+
+import (
+	"net/http"
+
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+// Verifier checks that an incoming HTTP request was signed by the private
+// key corresponding to key, using the proofing method the Verifier
+// implements.
+type Verifier interface {
+	// Verify returns an error unless r (with the given already-read body)
+	// carries a valid proof of possession of key.
+	Verify(r *http.Request, body []byte, key *gnap.Key) error
+}
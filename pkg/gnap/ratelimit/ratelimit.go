@@ -0,0 +1,172 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package ratelimit provides a per-key token-bucket rate limiter, used to
+// protect the GNAP endpoints from a single client or source IP overwhelming
+// the server.
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Config configures a Limiter.
+type Config struct {
+	// RPS is the sustained requests-per-second allowed per key.
+	RPS float64
+	// Burst is the largest burst of requests allowed per key.
+	Burst int
+	// IdleTTL is how long a key's bucket is kept after its last use before
+	// being evicted. Defaults to 10 minutes if zero.
+	IdleTTL time.Duration
+	// EvictInterval is how often the eviction sweep runs. Defaults to
+	// IdleTTL if zero.
+	EvictInterval time.Duration
+	// MaxKeys bounds how many distinct keys' buckets this Limiter holds at
+	// once. Inserting past it evicts the least-recently-used bucket
+	// immediately, so a flood of distinct keys can't grow this cache
+	// without bound between idle-eviction sweeps. Defaults to 10,000 if
+	// zero.
+	MaxKeys int
+}
+
+// Limiter is an in-memory, per-key token-bucket rate limiter, bounded to at
+// most cfg.MaxKeys buckets via least-recently-used eviction, with background
+// eviction of idle keys on top.
+type Limiter struct {
+	cfg Config
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	order   *list.List
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+type entry struct {
+	key    string
+	bucket *bucket
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// New returns a Limiter and starts its eviction loop.
+func New(cfg Config) *Limiter {
+	if cfg.IdleTTL <= 0 {
+		cfg.IdleTTL = 10 * time.Minute
+	}
+
+	if cfg.EvictInterval <= 0 {
+		cfg.EvictInterval = cfg.IdleTTL
+	}
+
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = 10000
+	}
+
+	l := &Limiter{
+		cfg:     cfg,
+		buckets: map[string]*list.Element{},
+		order:   list.New(),
+		done:    make(chan struct{}),
+	}
+
+	go l.evictLoop()
+
+	return l
+}
+
+// Close stops the Limiter's background eviction loop.
+func (l *Limiter) Close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+// Allow reports whether a request keyed by key may proceed. When it may
+// not, it also returns how long the caller should wait before retrying; that
+// wait is zero when no wait would let the request through (eg. Burst is
+// zero, or RPS is zero and the burst is used up).
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.buckets[key]
+
+	var b *bucket
+
+	if ok {
+		b = el.Value.(*entry).bucket
+		l.order.MoveToFront(el)
+	} else {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(l.cfg.RPS), l.cfg.Burst)}
+		l.buckets[key] = l.order.PushFront(&entry{key: key, bucket: b})
+		l.evictOverCapacity()
+	}
+
+	b.lastSeen = time.Now()
+
+	res := b.limiter.Reserve()
+	if !res.OK() {
+		return false, 0
+	}
+
+	if delay := res.Delay(); delay > 0 {
+		res.Cancel()
+
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// evictOverCapacity drops the least-recently-used buckets until the Limiter
+// holds at most cfg.MaxKeys. Callers must hold l.mu.
+func (l *Limiter) evictOverCapacity() {
+	for len(l.buckets) > l.cfg.MaxKeys {
+		oldest := l.order.Back()
+		if oldest == nil {
+			return
+		}
+
+		l.order.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*entry).key)
+	}
+}
+
+func (l *Limiter) evictLoop() {
+	ticker := time.NewTicker(l.cfg.EvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.evict()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *Limiter) evict() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, el := range l.buckets {
+		if time.Since(el.Value.(*entry).bucket.lastSeen) > l.cfg.IdleTTL {
+			l.order.Remove(el)
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Run("allows up to burst then denies", func(t *testing.T) {
+		l := New(Config{RPS: 1, Burst: 2})
+		defer l.Close()
+
+		ok, _ := l.Allow("client-1")
+		require.True(t, ok)
+
+		ok, _ = l.Allow("client-1")
+		require.True(t, ok)
+
+		ok, retryAfter := l.Allow("client-1")
+		require.False(t, ok)
+		require.Greater(t, retryAfter, time.Duration(0))
+	})
+
+	t.Run("separate buckets per key", func(t *testing.T) {
+		l := New(Config{RPS: 1, Burst: 1})
+		defer l.Close()
+
+		ok, _ := l.Allow("client-1")
+		require.True(t, ok)
+
+		ok, _ = l.Allow("client-1")
+		require.False(t, ok)
+
+		ok, _ = l.Allow("client-2")
+		require.True(t, ok)
+	})
+}
+
+func TestLimiter_maxKeys(t *testing.T) {
+	l := New(Config{RPS: 1, Burst: 1, MaxKeys: 2})
+	defer l.Close()
+
+	ok, _ := l.Allow("client-1")
+	require.True(t, ok)
+
+	ok, _ = l.Allow("client-2")
+	require.True(t, ok)
+
+	// client-1 is now least-recently-used; inserting client-3 should evict it
+	// rather than let the bucket count grow past MaxKeys.
+	ok, _ = l.Allow("client-3")
+	require.True(t, ok)
+
+	l.mu.Lock()
+	_, ok = l.buckets["client-1"]
+	count := len(l.buckets)
+	l.mu.Unlock()
+
+	require.False(t, ok)
+	require.Equal(t, 2, count)
+
+	// client-1 was evicted, so it gets a fresh bucket rather than being
+	// treated as still over its burst from before.
+	ok, _ = l.Allow("client-1")
+	require.True(t, ok)
+}
+
+func TestLimiter_evict(t *testing.T) {
+	l := New(Config{RPS: 1, Burst: 1, IdleTTL: time.Millisecond, EvictInterval: time.Millisecond})
+	defer l.Close()
+
+	ok, _ := l.Allow("client-1")
+	require.True(t, ok)
+
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		_, ok := l.buckets["client-1"]
+		l.mu.Unlock()
+
+		return !ok
+	}, time.Second, time.Millisecond*5)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package mockstorage provides an in-memory storage.Provider for unit tests,
+// with injectable errors for exercising failure paths without pulling in a
+// test-only dependency on aries-framework-go's own mock storage.
+package mockstorage
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// ErrDataNotFound is returned by Get/GetTags when the key does not exist.
+var ErrDataNotFound = storage.ErrDataNotFound
+
+// Provider is a mock storage.Provider.
+type Provider struct {
+	ErrOpenStoreHandle error
+	ErrSetStoreConfig  error
+	ErrGetStoreConfig  error
+	ErrClose           error
+
+	lock   sync.Mutex
+	stores map[string]*Store
+}
+
+// OpenStore returns the named store, creating it on first use.
+func (p *Provider) OpenStore(name string) (storage.Store, error) {
+	if p.ErrOpenStoreHandle != nil {
+		return nil, p.ErrOpenStoreHandle
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.stores == nil {
+		p.stores = map[string]*Store{}
+	}
+
+	s, ok := p.stores[name]
+	if !ok {
+		s = &Store{data: map[string][]byte{}}
+		p.stores[name] = s
+	}
+
+	return s, nil
+}
+
+// SetStoreConfig is a no-op mock.
+func (p *Provider) SetStoreConfig(_ string, _ storage.StoreConfiguration) error {
+	return p.ErrSetStoreConfig
+}
+
+// GetStoreConfig returns an empty config.
+func (p *Provider) GetStoreConfig(_ string) (storage.StoreConfiguration, error) {
+	return storage.StoreConfiguration{}, p.ErrGetStoreConfig
+}
+
+// GetOpenStores returns the currently open stores.
+func (p *Provider) GetOpenStores() []storage.Store {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	out := make([]storage.Store, 0, len(p.stores))
+	for _, s := range p.stores {
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// Close is a no-op mock.
+func (p *Provider) Close() error {
+	return p.ErrClose
+}
+
+// Store is a mock storage.Store backed by an in-memory map.
+type Store struct {
+	ErrPut     error
+	ErrGet     error
+	ErrDelete  error
+	ErrQuery   error
+	ErrGetTags error
+
+	lock sync.RWMutex
+	data map[string][]byte
+	tags map[string][]storage.Tag
+}
+
+// Put stores value under key.
+func (s *Store) Put(key string, value []byte, tags ...storage.Tag) error {
+	if s.ErrPut != nil {
+		return s.ErrPut
+	}
+
+	if key == "" {
+		return errors.New("key is mandatory")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.data == nil {
+		s.data = map[string][]byte{}
+	}
+
+	if s.tags == nil {
+		s.tags = map[string][]storage.Tag{}
+	}
+
+	s.data[key] = value
+	s.tags[key] = tags
+
+	return nil
+}
+
+// Get returns the value stored under key.
+func (s *Store) Get(key string) ([]byte, error) {
+	if s.ErrGet != nil {
+		return nil, s.ErrGet
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	v, ok := s.data[key]
+	if !ok {
+		return nil, storage.ErrDataNotFound
+	}
+
+	return v, nil
+}
+
+// GetTags returns the tags stored under key.
+func (s *Store) GetTags(key string) ([]storage.Tag, error) {
+	if s.ErrGetTags != nil {
+		return nil, s.ErrGetTags
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if _, ok := s.data[key]; !ok {
+		return nil, storage.ErrDataNotFound
+	}
+
+	return s.tags[key], nil
+}
+
+// GetBulk returns the values stored under keys.
+func (s *Store) GetBulk(keys ...string) ([][]byte, error) {
+	out := make([][]byte, len(keys))
+
+	for i, k := range keys {
+		v, err := s.Get(k)
+		if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+			return nil, err
+		}
+
+		out[i] = v
+	}
+
+	return out, nil
+}
+
+// Query is unsupported by this mock.
+func (s *Store) Query(_ string, _ ...storage.QueryOption) (storage.Iterator, error) {
+	return nil, s.ErrQuery
+}
+
+// Delete removes key.
+func (s *Store) Delete(key string) error {
+	if s.ErrDelete != nil {
+		return s.ErrDelete
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.data, key)
+	delete(s.tags, key)
+
+	return nil
+}
+
+// Batch is unsupported by this mock.
+func (s *Store) Batch(_ []storage.Operation) error {
+	return nil
+}
+
+// Flush is a no-op.
+func (s *Store) Flush() error {
+	return nil
+}
+
+// Close is a no-op.
+func (s *Store) Close() error {
+	return nil
+}
@@ -0,0 +1,252 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package introspect implements GNAP token introspection (RFC-to-be,
+// draft-ietf-gnap-resource-servers): recording the access and key bound to a
+// token when it is issued, and answering a resource server's introspection
+// request for it later.
+package introspect
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+const storeName = "gnap_token"
+
+// ErrTokenNotFound is returned by Revoke when the token is unknown to this
+// server. Introspect reports an unknown token as inactive instead.
+var ErrTokenNotFound = errors.New("token not found")
+
+// ErrKeyMismatch is returned by Revoke when the caller's key does not match
+// the key bound to the token at issuance.
+var ErrKeyMismatch = errors.New("key mismatch")
+
+// TokenRecord is the data bound to an access token at issuance time, as
+// recorded by Service.Put and looked up by Service.Introspect.
+type TokenRecord struct {
+	Access   []gnap.RequestAccess `json:"access"`
+	Key      *gnap.Key            `json:"key"`
+	Client   *gnap.ClientInstance `json:"client"`
+	State    string               `json:"state"`
+	IssuedAt time.Time            `json:"issued_at"`
+}
+
+// Token lifecycle states.
+const (
+	StateActive  = "active"
+	StateRevoked = "revoked"
+	StateExpired = "expired"
+)
+
+// Service records issued access tokens, answers introspection requests for
+// them, and retires them on revocation or expiry.
+type Service struct {
+	store storage.Store
+	ttl   time.Duration // zero disables time-based expiry
+
+	mu     sync.Mutex
+	issued map[string]time.Time // token -> IssuedAt, so Sweep can find expiry candidates without a store scan
+}
+
+// New returns a Service backed by the "gnap_token" store opened from
+// provider. ttl is how long an issued token stays active; Introspect treats
+// a record older than ttl as inactive even if Sweep has not yet run (eg.
+// after a restart, when the in-memory issued index starts out empty), so
+// expiry is enforced from the persisted IssuedAt rather than relying
+// solely on Sweep's own bookkeeping. Zero disables time-based expiry.
+func New(provider storage.Provider, ttl time.Duration) (*Service, error) {
+	store, err := provider.OpenStore(storeName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{store: store, ttl: ttl, issued: map[string]time.Time{}}, nil
+}
+
+// Put records the access and key bound to token, in the active state.
+func (s *Service) Put(token string, rec *TokenRecord) error {
+	rec.State = StateActive
+	rec.IssuedAt = time.Now()
+
+	if err := s.persist(token, rec); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.issued[token] = rec.IssuedAt
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Revoke marks token as revoked, provided client presents the same key that
+// was bound to it at issuance.
+func (s *Service) Revoke(token string, client *gnap.ClientInstance) error {
+	rec, err := s.get(token)
+	if err != nil {
+		return err
+	}
+
+	if !keyMatches(rec.Key, client) {
+		return ErrKeyMismatch
+	}
+
+	rec.State = StateRevoked
+
+	if err := s.persist(token, rec); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.issued, token)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Sweep marks every token issued more than ttl ago as expired, returning the
+// number of tokens it expired. Only tokens Put through this Service (its
+// in-memory issued index) are considered; records persisted by an earlier
+// process are not swept.
+func (s *Service) Sweep(ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	candidates := make(map[string]time.Time, len(s.issued))
+
+	for token, issuedAt := range s.issued {
+		if time.Since(issuedAt) > ttl {
+			candidates[token] = issuedAt
+		}
+	}
+	s.mu.Unlock()
+
+	expired := 0
+
+	for token := range candidates {
+		rec, err := s.get(token)
+		if errors.Is(err, ErrTokenNotFound) {
+			s.mu.Lock()
+			delete(s.issued, token)
+			s.mu.Unlock()
+
+			continue
+		}
+
+		if err != nil {
+			return expired, err
+		}
+
+		if rec.State == StateActive {
+			rec.State = StateExpired
+
+			if err := s.persist(token, rec); err != nil {
+				return expired, err
+			}
+
+			expired++
+		}
+
+		s.mu.Lock()
+		delete(s.issued, token)
+		s.mu.Unlock()
+	}
+
+	return expired, nil
+}
+
+func (s *Service) persist(token string, rec *TokenRecord) error {
+	bits, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Put(token, bits)
+}
+
+// Introspect looks up token and reports whether it is currently active. The
+// response's `key` is the token's bound proofing key, returned only if
+// rsAuthenticated reports that the caller already proved possession of its
+// own resource-server key; a real resource server never holds the client's
+// key, so disclosure can't be gated on the two matching.
+func (s *Service) Introspect(req *gnap.IntrospectRequest, rsAuthenticated bool) (*gnap.IntrospectResponse, error) {
+	if req == nil || req.AccessToken == "" {
+		return &gnap.IntrospectResponse{Active: false}, nil
+	}
+
+	rec, err := s.get(req.AccessToken)
+	if errors.Is(err, ErrTokenNotFound) {
+		return &gnap.IntrospectResponse{Active: false}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rec.State != StateActive || s.expired(rec) {
+		return &gnap.IntrospectResponse{Active: false}, nil
+	}
+
+	resp := &gnap.IntrospectResponse{
+		Active: true,
+		Access: rec.Access,
+		Client: rec.Client,
+	}
+
+	if rsAuthenticated {
+		resp.Key = rec.Key
+	}
+
+	return resp, nil
+}
+
+// expired reports whether rec is older than s.ttl, independent of its
+// persisted State and of whether Sweep has run, so a restarted process
+// (whose issued index starts empty) still honors the TTL.
+func (s *Service) expired(rec *TokenRecord) bool {
+	return s.ttl > 0 && time.Since(rec.IssuedAt) > s.ttl
+}
+
+func (s *Service) get(token string) (*TokenRecord, error) {
+	bits, err := s.store.Get(token)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return nil, ErrTokenNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &TokenRecord{}
+	if err := json.Unmarshal(bits, rec); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func keyMatches(bound *gnap.Key, rs *gnap.ClientInstance) bool {
+	if bound == nil || rs == nil || rs.Key == nil {
+		return false
+	}
+
+	boundJWK, err := json.Marshal(bound.JWK)
+	if err != nil {
+		return false
+	}
+
+	rsJWK, err := json.Marshal(rs.Key.JWK)
+	if err != nil {
+		return false
+	}
+
+	return string(boundJWK) == string(rsJWK)
+}
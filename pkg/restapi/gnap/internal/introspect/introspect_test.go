@@ -0,0 +1,202 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package introspect
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/auth/pkg/internal/common/mockstorage"
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+var errExpected = errors.New("expected error")
+
+func marshal(t *testing.T, rec *TokenRecord) []byte {
+	t.Helper()
+
+	bits, err := json.Marshal(rec)
+	require.NoError(t, err)
+
+	return bits
+}
+
+func TestNew(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+		require.NotNil(t, s)
+	})
+
+	t.Run("store provider error", func(t *testing.T) {
+		s, err := New(&mockstorage.Provider{ErrOpenStoreHandle: errExpected}, time.Hour)
+		require.ErrorIs(t, err, errExpected)
+		require.Nil(t, s)
+	})
+}
+
+func TestService_Introspect(t *testing.T) {
+	rsKey := &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "OKP"}}
+
+	t.Run("active token, RS authenticated", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("tok-1", &TokenRecord{
+			Access: []gnap.RequestAccess{{Type: "vc-issuer"}},
+			Key:    rsKey,
+		}))
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, true)
+		require.NoError(t, err)
+		require.True(t, resp.Active)
+		require.NotNil(t, resp.Key)
+		require.Len(t, resp.Access, 1)
+	})
+
+	t.Run("active token, RS not authenticated omits key", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("tok-1", &TokenRecord{Key: rsKey}))
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, false)
+		require.NoError(t, err)
+		require.True(t, resp.Active)
+		require.Nil(t, resp.Key)
+	})
+
+	t.Run("revoked token is inactive", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("tok-1", &TokenRecord{}))
+		require.NoError(t, s.store.Put("tok-1", marshal(t, &TokenRecord{State: StateRevoked})))
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, false)
+		require.NoError(t, err)
+		require.False(t, resp.Active)
+	})
+
+	t.Run("unknown token is inactive, not an error", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{AccessToken: "nope"}, false)
+		require.NoError(t, err)
+		require.False(t, resp.Active)
+	})
+
+	t.Run("empty request is inactive", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{}, false)
+		require.NoError(t, err)
+		require.False(t, resp.Active)
+	})
+
+	t.Run("token past ttl is inactive even if Sweep never ran", func(t *testing.T) {
+		provider := mem.NewProvider()
+
+		s, err := New(provider, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, s.store.Put("tok-1", marshal(t, &TokenRecord{
+			State:    StateActive,
+			IssuedAt: time.Now().Add(-2 * time.Hour),
+		})))
+
+		// a freshly constructed Service (simulating a process restart) has
+		// an empty issued index, so only the persisted IssuedAt is available
+		// to notice this record is past its ttl.
+		restarted, err := New(provider, time.Hour)
+		require.NoError(t, err)
+
+		resp, err := restarted.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, false)
+		require.NoError(t, err)
+		require.False(t, resp.Active)
+	})
+}
+
+func TestService_Revoke(t *testing.T) {
+	clientKey := &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "OKP"}}
+	client := &gnap.ClientInstance{Key: clientKey}
+
+	t.Run("revoke then introspect", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("tok-1", &TokenRecord{Key: clientKey}))
+
+		require.NoError(t, s.Revoke("tok-1", client))
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, false)
+		require.NoError(t, err)
+		require.False(t, resp.Active)
+	})
+
+	t.Run("revoke with wrong key is rejected", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("tok-1", &TokenRecord{Key: clientKey}))
+
+		wrongClient := &gnap.ClientInstance{Key: &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "EC"}}}
+
+		err = s.Revoke("tok-1", wrongClient)
+		require.ErrorIs(t, err, ErrKeyMismatch)
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, false)
+		require.NoError(t, err)
+		require.True(t, resp.Active)
+	})
+
+	t.Run("revoke unknown token", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		err = s.Revoke("nope", client)
+		require.ErrorIs(t, err, ErrTokenNotFound)
+	})
+}
+
+func TestService_Sweep(t *testing.T) {
+	t.Run("expires tokens older than ttl", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("tok-1", &TokenRecord{}))
+
+		n, err := s.Sweep(0)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, false)
+		require.NoError(t, err)
+		require.False(t, resp.Active)
+	})
+
+	t.Run("does not expire tokens within ttl", func(t *testing.T) {
+		s, err := New(mem.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("tok-1", &TokenRecord{}))
+
+		n, err := s.Sweep(time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 0, n)
+
+		resp, err := s.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, false)
+		require.NoError(t, err)
+		require.True(t, resp.Active)
+	})
+}
@@ -0,0 +1,784 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package gnap implements the REST endpoints of this server's GNAP
+// (Grant Negotiation and Authorization Protocol) authorization server.
+package gnap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/auth/pkg/gnap/accesspolicy"
+	"github.com/trustbloc/auth/pkg/gnap/interact"
+	"github.com/trustbloc/auth/pkg/gnap/interact/usercode"
+	"github.com/trustbloc/auth/pkg/gnap/proof"
+	"github.com/trustbloc/auth/pkg/gnap/ratelimit"
+	"github.com/trustbloc/auth/pkg/restapi/gnap/internal/introspect"
+	"github.com/trustbloc/auth/spi/gnap"
+)
+
+// API endpoints.
+const (
+	AuthRequestPath    = "/gnap/auth"
+	InteractPath       = "/gnap/interact"
+	AuthContinuePath   = "/gnap/continue"
+	AuthIntrospectPath = "/gnap/introspect"
+	AuthRevokePath     = "/gnap/revoke"
+	UserCodeSubmitPath = "/gnap/device"
+	UserCodePollPath   = "/gnap/device/poll"
+)
+
+// GNAP error codes, as returned in the body of an ErrorResponse.
+const (
+	errInvalidRequest = "invalid_request"
+	errRequestDenied  = "request_denied"
+	errTooFast        = "too_fast"
+)
+
+// InteractionHandler prepares the `interact` section of a grant response.
+type InteractionHandler = interact.Handler
+
+// SubjectAuthenticator authenticates the end user submitting a user_code
+// and reports the subject to bind the redeemed interaction to. This package
+// holds no session state of its own; it is the integrator's hook into
+// whatever session mechanism (eg. a login cookie) fronts this server.
+type SubjectAuthenticator interface {
+	Authenticate(r *http.Request) (subject string, err error)
+}
+
+// Config configures an Operation.
+type Config struct {
+	StoreProvider      storage.Provider
+	AccessPolicy       *accesspolicy.AccessPolicy
+	BaseURL            string
+	InteractionHandler InteractionHandler
+	// TokenTTL is how long an issued access token remains valid. Tokens
+	// older than this are marked expired by a background sweeper; their
+	// records are kept in the store. Zero disables the sweeper.
+	TokenTTL time.Duration
+	// ProofVerifiers maps a GNAP `proof` method name (eg. "httpsig") to the
+	// Verifier that checks it. A client key naming a proof method missing
+	// from this map is rejected.
+	ProofVerifiers map[string]proof.Verifier
+	// RateLimit configures per-key request throttling on the auth request,
+	// continue, and introspect endpoints. Nil disables rate limiting.
+	RateLimit *ratelimit.Config
+	// TrustedProxies lists the IPs (as seen in RemoteAddr) allowed to set
+	// X-Forwarded-For when determining a request's source IP for rate
+	// limiting.
+	TrustedProxies []string
+	// UserCodeHandler, if set, enables the user_code interaction start mode
+	// alongside InteractionHandler's redirect mode.
+	UserCodeHandler *usercode.Handler
+	// SubjectAuthenticator authenticates the end user submitting a
+	// user_code, required to enable the submit endpoint. Without it a
+	// submission carries no verified subject, so the submit endpoint
+	// refuses every request rather than trust one supplied by the caller.
+	SubjectAuthenticator SubjectAuthenticator
+}
+
+// pendingGrant tracks a grant request that is awaiting interaction, from
+// the initial AuthRequest that created it through the ContinueRequest that
+// redeems it for access tokens.
+type pendingGrant struct {
+	interactRef string
+	tokens      []gnap.TokenRequest
+	client      *gnap.ClientInstance
+	consumed    bool
+}
+
+// Operation implements the HTTP handlers for the GNAP authorization server
+// endpoints.
+type Operation struct {
+	accessPolicy     *accesspolicy.AccessPolicy
+	baseURL          string
+	interactHandlers map[string]InteractionHandler // GNAP `start` mode -> handler
+	introspector     *introspect.Service
+	proofVerifiers   map[string]proof.Verifier
+	limiter          *ratelimit.Limiter
+	trustedProxies   map[string]struct{}
+	userCode         *usercode.Handler
+	subjectAuth      SubjectAuthenticator
+
+	pendingMu     sync.Mutex
+	pendingGrants map[string]*pendingGrant // continuation access token -> pending grant
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// New returns a new Operation, starting its token sweeper if config.TokenTTL
+// is set.
+func New(config *Config) (*Operation, error) {
+	introspector, err := introspect.New(config.StoreProvider, config.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Operation{
+		accessPolicy:     config.AccessPolicy,
+		baseURL:          config.BaseURL,
+		interactHandlers: interactionHandlerSet(config.InteractionHandler, config.UserCodeHandler),
+		introspector:     introspector,
+		proofVerifiers:   config.ProofVerifiers,
+		trustedProxies:   trustedProxySet(config.TrustedProxies),
+		userCode:         config.UserCodeHandler,
+		subjectAuth:      config.SubjectAuthenticator,
+		pendingGrants:    map[string]*pendingGrant{},
+		done:             make(chan struct{}),
+	}
+
+	if config.RateLimit != nil {
+		o.limiter = ratelimit.New(*config.RateLimit)
+	}
+
+	if config.TokenTTL > 0 {
+		go o.sweepLoop(config.TokenTTL)
+	}
+
+	return o, nil
+}
+
+func trustedProxySet(proxies []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(proxies))
+
+	for _, p := range proxies {
+		set[p] = struct{}{}
+	}
+
+	return set
+}
+
+// interactionHandlerSet indexes redirectHandler and userCodeHandler by the
+// GNAP `start` mode each implements, so authRequestHandler can dispatch on
+// req.Interact.Start. Either may be nil to leave that mode unsupported.
+func interactionHandlerSet(redirectHandler InteractionHandler, userCodeHandler *usercode.Handler) map[string]InteractionHandler {
+	handlers := map[string]InteractionHandler{}
+
+	if redirectHandler != nil {
+		handlers[redirectHandler.Mode()] = redirectHandler
+	}
+
+	if userCodeHandler != nil {
+		handlers[userCodeHandler.Mode()] = userCodeHandler
+	}
+
+	return handlers
+}
+
+// Close stops the background token sweeper and rate limiter, if running.
+func (o *Operation) Close() {
+	o.closeOnce.Do(func() {
+		close(o.done)
+
+		if o.limiter != nil {
+			o.limiter.Close()
+		}
+	})
+}
+
+func (o *Operation) sweepLoop(ttl time.Duration) {
+	ticker := time.NewTicker(ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, _ = o.introspector.Sweep(ttl)
+		case <-o.done:
+			return
+		}
+	}
+}
+
+// Handler describes a single REST endpoint.
+type Handler struct {
+	method string
+	path   string
+	handle http.HandlerFunc
+}
+
+// Method returns the endpoint's HTTP method.
+func (h *Handler) Method() string { return h.method }
+
+// Path returns the endpoint's URL path.
+func (h *Handler) Path() string { return h.path }
+
+// Handle returns the endpoint's http.HandlerFunc.
+func (h *Handler) Handle() http.HandlerFunc { return h.handle }
+
+// GetRESTHandlers returns this Operation's HTTP handlers.
+func (o *Operation) GetRESTHandlers() []Handler {
+	return []Handler{
+		{method: http.MethodPost, path: AuthRequestPath, handle: o.rateLimited(o.authRequestHandler)},
+		{method: http.MethodGet, path: InteractPath, handle: o.interactHandler},
+		{method: http.MethodPost, path: AuthContinuePath, handle: o.rateLimited(o.authContinueHandler)},
+		{method: http.MethodPost, path: AuthIntrospectPath, handle: o.rateLimited(o.introspectHandler)},
+		{method: http.MethodPost, path: AuthRevokePath, handle: o.revokeHandler},
+		{method: http.MethodPost, path: UserCodeSubmitPath, handle: o.userCodeSubmitHandler},
+		{method: http.MethodPost, path: UserCodePollPath, handle: o.userCodePollHandler},
+	}
+}
+
+func (o *Operation) authRequestHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	req := &gnap.AuthRequest{}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	if req.Client != nil && req.Client.Key != nil {
+		if err := o.verifyProof(r, body, req.Client.Key); err != nil {
+			writeErrorResponse(w, http.StatusUnauthorized, errInvalidRequest)
+
+			return
+		}
+	}
+
+	if err := o.accessPolicy.Valid(req); err != nil {
+		writeErrorResponse(w, http.StatusUnauthorized, errRequestDenied)
+
+		return
+	}
+
+	if req.Interact == nil || len(req.Interact.Start) == 0 {
+		tokens, err := o.issueTokens(req.AccessToken, req.Client)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, errRequestDenied)
+
+			return
+		}
+
+		writeResponse(w, http.StatusOK, &gnap.AuthResponse{AccessToken: tokens})
+
+		return
+	}
+
+	o.startInteraction(w, req)
+}
+
+// startInteraction selects the interaction mode the client asked for,
+// prepares it, registers a pending grant bound to a fresh continuation
+// access token, and responds with the `interact` and `continue` sections
+// of the grant response.
+func (o *Operation) startInteraction(w http.ResponseWriter, req *gnap.AuthRequest) {
+	handler, err := o.selectInteractionHandler(req.Interact.Start)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	interactRef, err := randomToken()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, errRequestDenied)
+
+		return
+	}
+
+	interactResp, err := handler.PrepareInteraction(interactRef, req.Interact)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, errRequestDenied)
+
+		return
+	}
+
+	continueToken, err := randomToken()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, errRequestDenied)
+
+		return
+	}
+
+	o.putPendingGrant(continueToken, &pendingGrant{
+		interactRef: interactRef,
+		tokens:      req.AccessToken,
+		client:      req.Client,
+	})
+
+	writeResponse(w, http.StatusOK, &gnap.AuthResponse{
+		Interact: interactResp,
+		Continue: &gnap.ContinueResponse{URI: o.baseURL + AuthContinuePath, AccessToken: continueToken},
+	})
+}
+
+// selectInteractionHandler returns the first of this server's configured
+// interaction handlers whose mode appears in start, the client's requested
+// interaction start modes, in the order the client listed them.
+func (o *Operation) selectInteractionHandler(start []string) (InteractionHandler, error) {
+	for _, mode := range start {
+		if handler, ok := o.interactHandlers[mode]; ok {
+			return handler, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no supported interaction start mode in %v", start)
+}
+
+func (o *Operation) interactHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (o *Operation) authContinueHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := gnapTokenFromHeader(r)
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, errRequestDenied)
+
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	req := &gnap.ContinueRequest{}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	if req.Client != nil && req.Client.Key != nil {
+		if err := o.verifyProof(r, body, req.Client.Key); err != nil {
+			writeErrorResponse(w, http.StatusUnauthorized, errInvalidRequest)
+
+			return
+		}
+	}
+
+	pg, ok := o.lookupPendingGrant(token)
+	if !ok || pg.consumed || req.InteractRef == "" || pg.interactRef != req.InteractRef {
+		writeErrorResponse(w, http.StatusUnauthorized, errRequestDenied)
+
+		return
+	}
+
+	if o.userCode != nil {
+		entry, found := o.userCode.LookupByInteractRef(pg.interactRef)
+		if found && !entry.Redeemed {
+			writeErrorResponse(w, http.StatusUnauthorized, errRequestDenied)
+
+			return
+		}
+	}
+
+	// Claim the grant before issuing its tokens, so two concurrent
+	// continuations of the same token can't both pass the consumed check
+	// above and each walk away with a valid access token.
+	if !o.claimPendingGrant(token) {
+		writeErrorResponse(w, http.StatusUnauthorized, errRequestDenied)
+
+		return
+	}
+
+	tokens, err := o.issueTokens(pg.tokens, pg.client)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, errRequestDenied)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, &gnap.AuthResponse{AccessToken: tokens})
+}
+
+// issueTokens mints and persists (via introspector.Put) one access token
+// per requested TokenRequest, each bound to client's key so introspectHandler
+// and revokeHandler can later find it.
+func (o *Operation) issueTokens(reqs []gnap.TokenRequest, client *gnap.ClientInstance) ([]gnap.AccessToken, error) {
+	var key *gnap.Key
+	if client != nil {
+		key = client.Key
+	}
+
+	tokens := make([]gnap.AccessToken, 0, len(reqs))
+
+	for _, tr := range reqs {
+		value, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := o.introspector.Put(value, &introspect.TokenRecord{
+			Access: tr.Access,
+			Key:    key,
+			Client: client,
+		}); err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, gnap.AccessToken{Value: value, Access: tr.Access, Label: tr.Label})
+	}
+
+	return tokens, nil
+}
+
+// putPendingGrant registers pg under token, the continuation access token
+// the client must present to redeem it.
+func (o *Operation) putPendingGrant(token string, pg *pendingGrant) {
+	o.pendingMu.Lock()
+	o.pendingGrants[token] = pg
+	o.pendingMu.Unlock()
+}
+
+// lookupPendingGrant returns the pending grant registered under token, if
+// any.
+func (o *Operation) lookupPendingGrant(token string) (*pendingGrant, bool) {
+	o.pendingMu.Lock()
+	defer o.pendingMu.Unlock()
+
+	pg, ok := o.pendingGrants[token]
+
+	return pg, ok
+}
+
+// claimPendingGrant atomically marks the pending grant registered under
+// token as consumed and reports whether it was available to claim, so
+// concurrent continuations of the same token can't both succeed.
+func (o *Operation) claimPendingGrant(token string) bool {
+	o.pendingMu.Lock()
+	defer o.pendingMu.Unlock()
+
+	pg, ok := o.pendingGrants[token]
+	if !ok || pg.consumed {
+		return false
+	}
+
+	pg.consumed = true
+
+	return true
+}
+
+// randomToken returns an opaque, URL-safe random token suitable for use as
+// a GNAP access token, continuation token, or interact_ref.
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (o *Operation) userCodeSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	if o.userCode == nil || o.subjectAuth == nil {
+		writeErrorResponse(w, http.StatusNotFound, errInvalidRequest)
+
+		return
+	}
+
+	subject, err := o.subjectAuth.Authenticate(r)
+	if err != nil {
+		writeErrorResponse(w, http.StatusUnauthorized, errRequestDenied)
+
+		return
+	}
+
+	req := &gnap.UserCodeSubmitRequest{}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	if err := o.userCode.Submit(req.Code, subject); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (o *Operation) userCodePollHandler(w http.ResponseWriter, r *http.Request) {
+	if o.userCode == nil {
+		writeErrorResponse(w, http.StatusNotFound, errInvalidRequest)
+
+		return
+	}
+
+	req := &gnap.ContinueRequest{}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	pg, ok := o.userCode.LookupByInteractRef(req.InteractRef)
+	if !ok {
+		writeResponse(w, http.StatusOK, &gnap.UserCodePollResponse{Status: gnap.UserCodeStatusNotFound})
+
+		return
+	}
+
+	if pg.Redeemed {
+		writeResponse(w, http.StatusOK, &gnap.UserCodePollResponse{Status: gnap.UserCodeStatusRedeemed})
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, &gnap.UserCodePollResponse{Status: gnap.UserCodeStatusPending})
+}
+
+func (o *Operation) introspectHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	req := &gnap.IntrospectRequest{}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	// The token's bound key (IntrospectResponse.Key) is only disclosed once
+	// the resource server has proven possession of its own key, below; the
+	// RS never holds the client's key, so disclosure can't require the two
+	// to match, only that the caller is an authenticated RS.
+	rsAuthenticated := false
+
+	if req.ResourceServer != nil && req.ResourceServer.Key != nil {
+		if err := o.verifyProof(r, body, req.ResourceServer.Key); err != nil {
+			writeErrorResponse(w, http.StatusUnauthorized, errInvalidRequest)
+
+			return
+		}
+
+		rsAuthenticated = true
+	}
+
+	if o.introspector == nil {
+		writeResponse(w, http.StatusOK, &gnap.IntrospectResponse{Active: false})
+
+		return
+	}
+
+	resp, err := o.introspector.Introspect(req, rsAuthenticated)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, errRequestDenied)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, resp)
+}
+
+func (o *Operation) revokeHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	req := &gnap.RevokeRequest{}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	if req.AccessToken == "" || req.Client == nil || req.Client.Key == nil {
+		writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+		return
+	}
+
+	// A bound key is public, so matching it (inside Revoke) proves nothing
+	// on its own; require the caller to prove possession of it before
+	// trusting req.Client as the token's owner.
+	if err := o.verifyProof(r, body, req.Client.Key); err != nil {
+		writeErrorResponse(w, http.StatusUnauthorized, errInvalidRequest)
+
+		return
+	}
+
+	if err := o.introspector.Revoke(req.AccessToken, req.Client); err != nil {
+		writeErrorResponse(w, http.StatusUnauthorized, errRequestDenied)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// rateLimited wraps next so that it is only invoked if o's Limiter allows
+// the request, keyed by the client's key thumbprint once its proof of
+// possession verifies, or else its source IP. If o has no Limiter
+// configured, next runs unthrottled.
+func (o *Operation) rateLimited(next http.HandlerFunc) http.HandlerFunc {
+	if o.limiter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := o.requestRateLimitKey(r)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, errInvalidRequest)
+
+			return
+		}
+
+		ok, retryAfter := o.limiter.Allow(key)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeErrorResponse(w, http.StatusTooManyRequests, errTooFast)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requestRateLimitKey buckets r by its client (or resource server) instance's
+// key thumbprint, but only once r's proof of possession over that key
+// verifies — an unauthenticated JWK from the request body is never trusted
+// as a bucket identity, or a caller could dodge the limit by inventing a
+// fresh key on every request. Falls back to source IP when no key's proof
+// verifies. It restores r.Body after peeking at it so the wrapped handler
+// can still read it.
+func (o *Operation) requestRateLimitKey(r *http.Request) (string, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var peek struct {
+		Client         *gnap.ClientInstance `json:"client"`
+		ResourceServer *gnap.ClientInstance `json:"resource_server"`
+	}
+
+	if json.Unmarshal(body, &peek) == nil {
+		for _, ci := range []*gnap.ClientInstance{peek.Client, peek.ResourceServer} {
+			if ci == nil || ci.Key == nil {
+				continue
+			}
+
+			if err := o.verifyProof(r, body, ci.Key); err != nil {
+				continue
+			}
+
+			if th, ok := keyThumbprint(ci); ok {
+				return "key:" + th, nil
+			}
+		}
+	}
+
+	return "ip:" + sourceIP(r, o.trustedProxies), nil
+}
+
+func keyThumbprint(ci *gnap.ClientInstance) (string, bool) {
+	if ci == nil || ci.Key == nil || len(ci.Key.JWK) == 0 {
+		return "", false
+	}
+
+	bits, err := json.Marshal(ci.Key.JWK)
+	if err != nil {
+		return "", false
+	}
+
+	sum := sha256.Sum256(bits)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), true
+}
+
+// sourceIP returns r's source IP, honoring the leftmost X-Forwarded-For
+// entry only when RemoteAddr is itself a trusted proxy.
+func sourceIP(r *http.Request, trustedProxies map[string]struct{}) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if _, trusted := trustedProxies[host]; !trusted {
+		return host
+	}
+
+	fwd := r.Header.Get("X-Forwarded-For")
+	if fwd == "" {
+		return host
+	}
+
+	return strings.TrimSpace(strings.Split(fwd, ",")[0])
+}
+
+// verifyProof checks r's proof of possession of key, using the Verifier
+// registered for key's proof method. An unregistered proof method is
+// rejected.
+func (o *Operation) verifyProof(r *http.Request, body []byte, key *gnap.Key) error {
+	verifier, ok := o.proofVerifiers[key.Proof]
+	if !ok {
+		return fmt.Errorf("unsupported proof method %q", key.Proof)
+	}
+
+	return verifier.Verify(r, body, key)
+}
+
+// gnapTokenFromHeader returns the token carried by the Authorization
+// header's "GNAP <token>" value, if present. A request may carry more than
+// one Authorization value (eg. a Bearer token alongside the GNAP one), so
+// every value is scanned rather than just the first.
+func gnapTokenFromHeader(r *http.Request) (string, bool) {
+	const prefix = "GNAP "
+
+	for _, auth := range r.Header.Values("Authorization") {
+		if strings.HasPrefix(auth, prefix) {
+			return strings.TrimPrefix(auth, prefix), true
+		}
+	}
+
+	return "", false
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, errCode string) {
+	writeResponse(w, status, &gnap.ErrorResponse{Error: errCode})
+}
+
+func writeResponse(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
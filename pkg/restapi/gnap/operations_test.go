@@ -13,16 +13,36 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
 	"github.com/stretchr/testify/require"
 
 	"github.com/trustbloc/auth/pkg/gnap/accesspolicy"
 	"github.com/trustbloc/auth/pkg/gnap/interact/redirect"
+	"github.com/trustbloc/auth/pkg/gnap/interact/usercode"
+	"github.com/trustbloc/auth/pkg/gnap/proof"
+	"github.com/trustbloc/auth/pkg/gnap/ratelimit"
 	"github.com/trustbloc/auth/pkg/internal/common/mockstorage"
+	"github.com/trustbloc/auth/pkg/restapi/gnap/internal/introspect"
 	"github.com/trustbloc/auth/spi/gnap"
 )
 
+// stubVerifier is a test proof.Verifier that succeeds unless verify is set
+// and returns an error, letting tests simulate a verified or failed proof of
+// possession without real cryptography.
+type stubVerifier struct {
+	verify func(r *http.Request, body []byte, key *gnap.Key) error
+}
+
+func (v *stubVerifier) Verify(r *http.Request, body []byte, key *gnap.Key) error {
+	if v.verify != nil {
+		return v.verify(r, body, key)
+	}
+
+	return nil
+}
+
 func TestNew(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		o, err := New(config(t))
@@ -48,7 +68,7 @@ func TestOperation_GetRESTHandlers(t *testing.T) {
 	o := &Operation{}
 
 	h := o.GetRESTHandlers()
-	require.Len(t, h, 4)
+	require.Len(t, h, 7)
 }
 
 func TestOperation_authRequestHandler(t *testing.T) {
@@ -75,6 +95,143 @@ func TestOperation_authRequestHandler(t *testing.T) {
 
 		require.Equal(t, http.StatusUnauthorized, rw.Code)
 	})
+
+	t.Run("unregistered proof method is rejected", func(t *testing.T) {
+		o := &Operation{}
+
+		body, err := json.Marshal(&gnap.AuthRequest{
+			Client: &gnap.ClientInstance{Key: &gnap.Key{Proof: "unknown-method"}},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, AuthRequestPath, bytes.NewReader(body))
+
+		o.authRequestHandler(rw, req)
+
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+
+		resp := &gnap.ErrorResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.Equal(t, errInvalidRequest, resp.Error)
+	})
+
+	t.Run("no interaction requested issues a token immediately", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		body, err := json.Marshal(&gnap.AuthRequest{
+			AccessToken: []gnap.TokenRequest{{Access: []gnap.RequestAccess{{Type: "vc-issuer"}}}},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthRequestPath, bytes.NewReader(body))
+
+		o.authRequestHandler(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		resp := &gnap.AuthResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.Len(t, resp.AccessToken, 1)
+		require.NotEmpty(t, resp.AccessToken[0].Value)
+
+		introspectResp, err := o.introspector.Introspect(&gnap.IntrospectRequest{AccessToken: resp.AccessToken[0].Value}, false)
+		require.NoError(t, err)
+		require.True(t, introspectResp.Active)
+	})
+
+	t.Run("interaction requested returns interact and continue, no token yet", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		body, err := json.Marshal(&gnap.AuthRequest{
+			AccessToken: []gnap.TokenRequest{{Access: []gnap.RequestAccess{{Type: "vc-issuer"}}}},
+			Interact:    &gnap.RequestInteract{Start: []string{"redirect"}},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthRequestPath, bytes.NewReader(body))
+
+		o.authRequestHandler(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		resp := &gnap.AuthResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.Empty(t, resp.AccessToken)
+		require.NotNil(t, resp.Interact)
+		require.Equal(t, InteractPath, resp.Interact.Redirect)
+		require.NotNil(t, resp.Continue)
+		require.NotEmpty(t, resp.Continue.AccessToken)
+	})
+
+	t.Run("interaction requested but no interaction handler configured", func(t *testing.T) {
+		conf := config(t)
+		conf.InteractionHandler = nil
+
+		o, err := New(conf)
+		require.NoError(t, err)
+
+		body, err := json.Marshal(&gnap.AuthRequest{
+			AccessToken: []gnap.TokenRequest{{Access: []gnap.RequestAccess{{Type: "vc-issuer"}}}},
+			Interact:    &gnap.RequestInteract{Start: []string{"redirect"}},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthRequestPath, bytes.NewReader(body))
+
+		o.authRequestHandler(rw, req)
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("unsupported interaction start mode is rejected", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		body, err := json.Marshal(&gnap.AuthRequest{
+			AccessToken: []gnap.TokenRequest{{Access: []gnap.RequestAccess{{Type: "vc-issuer"}}}},
+			Interact:    &gnap.RequestInteract{Start: []string{"push"}},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthRequestPath, bytes.NewReader(body))
+
+		o.authRequestHandler(rw, req)
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("user_code mode is dispatched alongside redirect", func(t *testing.T) {
+		uc, err := usercode.New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		conf := config(t)
+		conf.UserCodeHandler = uc
+
+		o, err := New(conf)
+		require.NoError(t, err)
+
+		body, err := json.Marshal(&gnap.AuthRequest{
+			AccessToken: []gnap.TokenRequest{{Access: []gnap.RequestAccess{{Type: "vc-issuer"}}}},
+			Interact:    &gnap.RequestInteract{Start: []string{"user_code"}},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthRequestPath, bytes.NewReader(body))
+
+		o.authRequestHandler(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		resp := &gnap.AuthResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.NotNil(t, resp.Interact)
+		require.NotNil(t, resp.Interact.UserCode)
+		require.NotEmpty(t, resp.Interact.UserCode.Code)
+	})
 }
 
 func TestOperation_interactHandler(t *testing.T) {
@@ -159,18 +316,528 @@ func TestOperation_authContinueHandler(t *testing.T) {
 		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
 		require.Equal(t, errRequestDenied, resp.Error)
 	})
+
+	t.Run("GNAP value found after a Bearer value", func(t *testing.T) {
+		o := &Operation{}
+
+		rw := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, AuthContinuePath, nil)
+		req.Header.Add("Authorization", "Bearer mock-token")
+		req.Header.Add("Authorization", "GNAP mock-token")
+
+		o.authContinueHandler(rw, req)
+
+		// the GNAP value was found, so the request gets past the missing-token
+		// check and fails for lack of a body instead.
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+
+		resp := &gnap.ErrorResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.Equal(t, errInvalidRequest, resp.Error)
+	})
+
+	t.Run("a continuation token cannot be redeemed twice", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		o.putPendingGrant("mock-token", &pendingGrant{
+			interactRef: "ref-1",
+			tokens:      []gnap.TokenRequest{{Access: []gnap.RequestAccess{{Type: "vc-issuer"}}}},
+		})
+
+		pollBody, err := json.Marshal(&gnap.ContinueRequest{InteractRef: "ref-1"})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthContinuePath, bytes.NewReader(pollBody))
+		req.Header.Add("Authorization", "GNAP mock-token")
+		o.authContinueHandler(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		rw = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, AuthContinuePath, bytes.NewReader(pollBody))
+		req.Header.Add("Authorization", "GNAP mock-token")
+		o.authContinueHandler(rw, req)
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
 }
 
 func TestOperation_introspectHandler(t *testing.T) {
-	o := &Operation{}
+	t.Run("no resource server key presented", func(t *testing.T) {
+		o := &Operation{}
+
+		rw := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, AuthIntrospectPath, bytes.NewReader([]byte("{}")))
+
+		o.introspectHandler(rw, req)
+
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("resource server key without a valid proof is rejected", func(t *testing.T) {
+		o := &Operation{proofVerifiers: map[string]proof.Verifier{
+			"httpsig": &stubVerifier{verify: func(*http.Request, []byte, *gnap.Key) error {
+				return errors.New("invalid signature")
+			}},
+		}}
+
+		body, err := json.Marshal(&gnap.IntrospectRequest{
+			AccessToken:    "tok-1",
+			ResourceServer: &gnap.ClientInstance{Key: &gnap.Key{Proof: "httpsig"}},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthIntrospectPath, bytes.NewReader(body))
+
+		o.introspectHandler(rw, req)
+
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("resource server key with a valid proof proceeds", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		o.proofVerifiers = map[string]proof.Verifier{"httpsig": &stubVerifier{}}
+
+		rsKey := &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "OKP"}}
+
+		require.NoError(t, o.introspector.Put("tok-1", &introspect.TokenRecord{Key: rsKey}))
+
+		body, err := json.Marshal(&gnap.IntrospectRequest{
+			AccessToken:    "tok-1",
+			ResourceServer: &gnap.ClientInstance{Key: rsKey},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthIntrospectPath, bytes.NewReader(body))
+
+		o.introspectHandler(rw, req)
+
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		resp := &gnap.IntrospectResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.True(t, resp.Active)
+		require.NotNil(t, resp.Key)
+	})
+
+	t.Run("authenticated RS receives the token's bound key, distinct from its own", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		o.proofVerifiers = map[string]proof.Verifier{"httpsig": &stubVerifier{}}
+
+		clientKey := &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "OKP"}}
+		rsKey := &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "EC"}}
+
+		require.NoError(t, o.introspector.Put("tok-1", &introspect.TokenRecord{Key: clientKey}))
+
+		body, err := json.Marshal(&gnap.IntrospectRequest{
+			AccessToken:    "tok-1",
+			ResourceServer: &gnap.ClientInstance{Key: rsKey},
+		})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthIntrospectPath, bytes.NewReader(body))
+
+		o.introspectHandler(rw, req)
+
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		resp := &gnap.IntrospectResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.True(t, resp.Active)
+		require.Equal(t, clientKey, resp.Key)
+	})
+}
+
+func TestOperation_revokeHandler(t *testing.T) {
+	clientKey := &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "OKP"}}
+	client := &gnap.ClientInstance{Key: clientKey}
+
+	t.Run("fail to parse empty request body", func(t *testing.T) {
+		o := &Operation{}
+
+		rw := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, AuthRevokePath, nil)
+
+		o.revokeHandler(rw, req)
+
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+	})
 
-	rw := httptest.NewRecorder()
+	t.Run("revoke then introspect reports inactive", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		o.proofVerifiers = map[string]proof.Verifier{"httpsig": &stubVerifier{}}
+
+		require.NoError(t, o.introspector.Put("tok-1", &introspect.TokenRecord{Key: clientKey}))
+
+		body, err := json.Marshal(&gnap.RevokeRequest{AccessToken: "tok-1", Client: client})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthRevokePath, bytes.NewReader(body))
+
+		o.revokeHandler(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		rw = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, AuthIntrospectPath, bytes.NewReader([]byte(`{"access_token":"tok-1"}`)))
+
+		o.introspectHandler(rw, req)
+
+		resp := &gnap.IntrospectResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.False(t, resp.Active)
+	})
+
+	t.Run("revoke with wrong key is rejected", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		o.proofVerifiers = map[string]proof.Verifier{"httpsig": &stubVerifier{}}
+
+		require.NoError(t, o.introspector.Put("tok-1", &introspect.TokenRecord{Key: clientKey}))
+
+		wrongClient := &gnap.ClientInstance{Key: &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "EC"}}}
+
+		body, err := json.Marshal(&gnap.RevokeRequest{AccessToken: "tok-1", Client: wrongClient})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthRevokePath, bytes.NewReader(body))
+
+		o.revokeHandler(rw, req)
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("revoke without a valid proof is rejected even with the correct key", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
+
+		o.proofVerifiers = map[string]proof.Verifier{
+			"httpsig": &stubVerifier{verify: func(*http.Request, []byte, *gnap.Key) error {
+				return errors.New("invalid signature")
+			}},
+		}
+
+		require.NoError(t, o.introspector.Put("tok-1", &introspect.TokenRecord{Key: clientKey}))
+
+		// client presents the exact public key bound at issuance, but never
+		// signed the request, so keyMatches alone would wrongly let it pass.
+		body, err := json.Marshal(&gnap.RevokeRequest{AccessToken: "tok-1", Client: client})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthRevokePath, bytes.NewReader(body))
+
+		o.revokeHandler(rw, req)
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+}
+
+func TestOperation_sweeper(t *testing.T) {
+	conf := config(t)
+	conf.TokenTTL = time.Millisecond
+
+	o, err := New(conf)
+	require.NoError(t, err)
+	defer o.Close()
+
+	require.NoError(t, o.introspector.Put("tok-1", &introspect.TokenRecord{}))
+
+	require.Eventually(t, func() bool {
+		resp, introspectErr := o.introspector.Introspect(&gnap.IntrospectRequest{AccessToken: "tok-1"}, false)
+		return introspectErr == nil && !resp.Active
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestOperation_rateLimited(t *testing.T) {
+	reqFor := func(t *testing.T, c *gnap.ClientInstance) *http.Request {
+		t.Helper()
+
+		body, marshalErr := json.Marshal(&gnap.AuthRequest{Client: c})
+		require.NoError(t, marshalErr)
+
+		return httptest.NewRequest(http.MethodPost, AuthRequestPath, bytes.NewReader(body))
+	}
+
+	client1 := &gnap.ClientInstance{Key: &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "OKP", "x": "a"}}}
+	client2 := &gnap.ClientInstance{Key: &gnap.Key{Proof: "httpsig", JWK: map[string]interface{}{"kty": "OKP", "x": "b"}}}
+
+	t.Run("unverified client keys share the fallback IP bucket", func(t *testing.T) {
+		conf := config(t)
+		conf.RateLimit = &ratelimit.Config{RPS: 1, Burst: 1}
+
+		o, err := New(conf)
+		require.NoError(t, err)
+		defer o.Close()
+
+		h := o.rateLimited(o.authRequestHandler)
+
+		rw := httptest.NewRecorder()
+		h(rw, reqFor(t, client1))
+		require.NotEqual(t, http.StatusTooManyRequests, rw.Code)
+
+		// a client cannot dodge the limit by simply presenting a different,
+		// unsigned JWK: without a verified proof, neither key is trusted as
+		// the bucket identity, so both fall back to the shared source IP.
+		rw = httptest.NewRecorder()
+		h(rw, reqFor(t, client2))
+		require.Equal(t, http.StatusTooManyRequests, rw.Code)
+		require.NotEmpty(t, rw.Header().Get("Retry-After"))
+
+		resp := &gnap.ErrorResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		require.Equal(t, errTooFast, resp.Error)
+	})
+
+	t.Run("separate buckets per client key once its proof verifies", func(t *testing.T) {
+		conf := config(t)
+		conf.RateLimit = &ratelimit.Config{RPS: 1, Burst: 1}
+
+		o, err := New(conf)
+		require.NoError(t, err)
+		defer o.Close()
+
+		o.proofVerifiers = map[string]proof.Verifier{"httpsig": &stubVerifier{}}
+
+		h := o.rateLimited(o.authRequestHandler)
+
+		rw := httptest.NewRecorder()
+		h(rw, reqFor(t, client1))
+		require.NotEqual(t, http.StatusTooManyRequests, rw.Code)
+
+		rw = httptest.NewRecorder()
+		h(rw, reqFor(t, client1))
+		require.Equal(t, http.StatusTooManyRequests, rw.Code)
+		require.NotEmpty(t, rw.Header().Get("Retry-After"))
+
+		// a different client's key, once its own proof verifies, gets its
+		// own bucket.
+		rw = httptest.NewRecorder()
+		h(rw, reqFor(t, client2))
+		require.NotEqual(t, http.StatusTooManyRequests, rw.Code)
+	})
+
+	t.Run("falls back to source IP, honoring trusted proxy", func(t *testing.T) {
+		conf := config(t)
+		conf.RateLimit = &ratelimit.Config{RPS: 1, Burst: 1}
+		conf.TrustedProxies = []string{"10.0.0.1"}
+
+		o, err := New(conf)
+		require.NoError(t, err)
+		defer o.Close()
+
+		h := o.rateLimited(o.authRequestHandler)
+
+		newReq := func(forwardedFor string) *http.Request {
+			r := httptest.NewRequest(http.MethodPost, AuthRequestPath, bytes.NewReader([]byte("{}")))
+			r.RemoteAddr = "10.0.0.1:12345"
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+
+			return r
+		}
+
+		rw := httptest.NewRecorder()
+		h(rw, newReq("203.0.113.1"))
+		require.NotEqual(t, http.StatusTooManyRequests, rw.Code)
+
+		// same forwarded client IP through the trusted proxy shares the bucket.
+		rw = httptest.NewRecorder()
+		h(rw, newReq("203.0.113.1"))
+		require.Equal(t, http.StatusTooManyRequests, rw.Code)
+
+		// a different forwarded client IP gets its own bucket.
+		rw = httptest.NewRecorder()
+		h(rw, newReq("203.0.113.2"))
+		require.NotEqual(t, http.StatusTooManyRequests, rw.Code)
+	})
+}
+
+func TestOperation_userCode(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		o, err := New(config(t))
+		require.NoError(t, err)
 
-	req := httptest.NewRequest(http.MethodPost, AuthContinuePath, bytes.NewReader([]byte("{}")))
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, UserCodeSubmitPath, bytes.NewReader([]byte("{}")))
+
+		o.userCodeSubmitHandler(rw, req)
+		require.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("submit with no SubjectAuthenticator configured", func(t *testing.T) {
+		uc, err := usercode.New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		conf := config(t)
+		conf.UserCodeHandler = uc
+
+		o, err := New(conf)
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, UserCodeSubmitPath, bytes.NewReader([]byte("{}")))
+
+		o.userCodeSubmitHandler(rw, req)
+		require.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("submit then poll reports redeemed, and feeds authContinueHandler", func(t *testing.T) {
+		uc, err := usercode.New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		conf := config(t)
+		conf.UserCodeHandler = uc
+		conf.SubjectAuthenticator = stubSubjectAuthenticator("user-1")
+
+		o, err := New(conf)
+		require.NoError(t, err)
+
+		resp, err := uc.PrepareInteraction("ref-1", nil)
+		require.NoError(t, err)
+
+		submitBody, err := json.Marshal(&gnap.UserCodeSubmitRequest{Code: resp.UserCode.Code})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, UserCodeSubmitPath, bytes.NewReader(submitBody))
+		o.userCodeSubmitHandler(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		pollBody, err := json.Marshal(&gnap.ContinueRequest{InteractRef: "ref-1"})
+		require.NoError(t, err)
+
+		rw = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, UserCodePollPath, bytes.NewReader(pollBody))
+		o.userCodePollHandler(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		pollResp := &gnap.UserCodePollResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), pollResp))
+		require.Equal(t, gnap.UserCodeStatusRedeemed, pollResp.Status)
+
+		// simulates the pending grant authRequestHandler would have registered
+		// when it started this user_code interaction.
+		o.putPendingGrant("mock-token", &pendingGrant{
+			interactRef: "ref-1",
+			tokens:      []gnap.TokenRequest{{Access: []gnap.RequestAccess{{Type: "vc-issuer"}}}},
+		})
+
+		rw = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, AuthContinuePath, bytes.NewReader(pollBody))
+		req.Header.Add("Authorization", "GNAP mock-token")
+		o.authContinueHandler(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		continueResp := &gnap.AuthResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), continueResp))
+		require.Len(t, continueResp.AccessToken, 1)
+		require.NotEmpty(t, continueResp.AccessToken[0].Value)
+	})
+
+	t.Run("polling an unredeemed code", func(t *testing.T) {
+		uc, err := usercode.New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		conf := config(t)
+		conf.UserCodeHandler = uc
+
+		o, err := New(conf)
+		require.NoError(t, err)
+
+		_, err = uc.PrepareInteraction("ref-1", nil)
+		require.NoError(t, err)
+
+		pollBody, err := json.Marshal(&gnap.ContinueRequest{InteractRef: "ref-1"})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, UserCodePollPath, bytes.NewReader(pollBody))
+		o.userCodePollHandler(rw, req)
+
+		pollResp := &gnap.UserCodePollResponse{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), pollResp))
+		require.Equal(t, gnap.UserCodeStatusPending, pollResp.Status)
+	})
+
+	t.Run("continuing before the code is redeemed is rejected", func(t *testing.T) {
+		uc, err := usercode.New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		conf := config(t)
+		conf.UserCodeHandler = uc
+
+		o, err := New(conf)
+		require.NoError(t, err)
+
+		_, err = uc.PrepareInteraction("ref-1", nil)
+		require.NoError(t, err)
+
+		o.putPendingGrant("mock-token", &pendingGrant{
+			interactRef: "ref-1",
+			tokens:      []gnap.TokenRequest{{Access: []gnap.RequestAccess{{Type: "vc-issuer"}}}},
+		})
+
+		continueBody, err := json.Marshal(&gnap.ContinueRequest{InteractRef: "ref-1"})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, AuthContinuePath, bytes.NewReader(continueBody))
+		req.Header.Add("Authorization", "GNAP mock-token")
+		o.authContinueHandler(rw, req)
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("submit rejected when the caller's session doesn't authenticate", func(t *testing.T) {
+		uc, err := usercode.New("https://as.example/device", time.Minute)
+		require.NoError(t, err)
+
+		conf := config(t)
+		conf.UserCodeHandler = uc
+		conf.SubjectAuthenticator = stubSubjectAuthenticatorError{errors.New("no session")}
+
+		o, err := New(conf)
+		require.NoError(t, err)
+
+		resp, err := uc.PrepareInteraction("ref-1", nil)
+		require.NoError(t, err)
+
+		submitBody, err := json.Marshal(&gnap.UserCodeSubmitRequest{Code: resp.UserCode.Code})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, UserCodeSubmitPath, bytes.NewReader(submitBody))
+		o.userCodeSubmitHandler(rw, req)
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+}
+
+// stubSubjectAuthenticator is a SubjectAuthenticator that authenticates
+// every request as the given subject, for tests that don't exercise real
+// session handling.
+type stubSubjectAuthenticator string
+
+func (s stubSubjectAuthenticator) Authenticate(*http.Request) (string, error) {
+	return string(s), nil
+}
 
-	o.introspectHandler(rw, req)
+// stubSubjectAuthenticatorError is a SubjectAuthenticator that always fails,
+// simulating a caller with no authenticated session.
+type stubSubjectAuthenticatorError struct{ err error }
 
-	require.Equal(t, http.StatusOK, rw.Code)
+func (s stubSubjectAuthenticatorError) Authenticate(*http.Request) (string, error) {
+	return "", s.err
 }
 
 func config(t *testing.T) *Config {
@@ -0,0 +1,155 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package gnap holds the wire types for the GNAP (Grant Negotiation and
+// Authorization Protocol) messages exchanged between a client instance and
+// this authorization server.
+package gnap
+
+// Key describes a key bound to a client instance or to an access token, as
+// used in the GNAP `key` field.
+type Key struct {
+	Proof string                 `json:"proof"`
+	JWK   map[string]interface{} `json:"jwk,omitempty"`
+}
+
+// ClientInstance identifies the client making a request, including the key
+// it will use to protect that request and any continuation requests.
+type ClientInstance struct {
+	Key *Key `json:"key,omitempty"`
+}
+
+// RequestAccess is a single access right requested or granted, either as a
+// bare string reference or a structured object. Only the structured form is
+// modeled here.
+type RequestAccess struct {
+	Type      string   `json:"type"`
+	Actions   []string `json:"actions,omitempty"`
+	Locations []string `json:"locations,omitempty"`
+}
+
+// AuthRequest is the body of a POST to the grant request endpoint.
+type AuthRequest struct {
+	AccessToken []TokenRequest   `json:"access_token,omitempty"`
+	Client      *ClientInstance  `json:"client,omitempty"`
+	Interact    *RequestInteract `json:"interact,omitempty"`
+}
+
+// TokenRequest is a single access token ask within an AuthRequest.
+type TokenRequest struct {
+	Access []RequestAccess `json:"access,omitempty"`
+	Label  string          `json:"label,omitempty"`
+}
+
+// RequestInteract carries the client's requested interaction modes.
+type RequestInteract struct {
+	Start  []string        `json:"start,omitempty"`
+	Finish *InteractFinish `json:"finish,omitempty"`
+}
+
+// InteractFinish describes how the AS should notify the client that
+// interaction has finished.
+type InteractFinish struct {
+	Method string `json:"method"`
+	URI    string `json:"uri"`
+	Nonce  string `json:"nonce"`
+}
+
+// ContinueRequest is the body of a POST to the continuation endpoint.
+type ContinueRequest struct {
+	InteractRef string          `json:"interact_ref,omitempty"`
+	Client      *ClientInstance `json:"client,omitempty"`
+}
+
+// AuthResponse is the body of a successful response to the grant request
+// or continuation endpoint: either the requested access tokens, or (if
+// interaction is still pending) the means to complete it and continue.
+type AuthResponse struct {
+	AccessToken []AccessToken     `json:"access_token,omitempty"`
+	Continue    *ContinueResponse `json:"continue,omitempty"`
+	Interact    *ResponseInteract `json:"interact,omitempty"`
+}
+
+// AccessToken is a single access token issued in an AuthResponse.
+type AccessToken struct {
+	Value  string          `json:"value"`
+	Access []RequestAccess `json:"access,omitempty"`
+	Label  string          `json:"label,omitempty"`
+}
+
+// ContinueResponse tells the client how, and with what continuation
+// access token, to resume a grant request that is still awaiting
+// interaction.
+type ContinueResponse struct {
+	URI         string `json:"uri"`
+	AccessToken string `json:"access_token"`
+}
+
+// ResponseInteract is the `interact` field of a grant response, describing
+// how the client should direct the end user to interact with the AS.
+type ResponseInteract struct {
+	Redirect string            `json:"redirect,omitempty"`
+	UserCode *UserCodeInteract `json:"user_code,omitempty"`
+	Finish   string            `json:"finish,omitempty"`
+}
+
+// UserCodeInteract carries the human-typable code and verification URI used
+// by the GNAP `user_code` interaction start mode.
+type UserCodeInteract struct {
+	Code string `json:"code"`
+	URI  string `json:"uri"`
+}
+
+// RevokeRequest is the body of a POST to the revocation endpoint, sent by
+// the client instance that a token (or its continuation) was issued to.
+type RevokeRequest struct {
+	AccessToken string          `json:"access_token"`
+	Client      *ClientInstance `json:"client,omitempty"`
+}
+
+// UserCodeSubmitRequest is the body of a POST from an end user redeeming a
+// user_code interaction's code. The subject is never taken from this body:
+// the server derives it from the caller's authenticated session via its
+// configured SubjectAuthenticator.
+type UserCodeSubmitRequest struct {
+	Code string `json:"code"`
+}
+
+// UserCodePollResponse reports the current state of a user_code
+// interaction to the client instance polling it.
+type UserCodePollResponse struct {
+	Status string `json:"status"`
+}
+
+// User code interaction poll statuses.
+const (
+	UserCodeStatusPending  = "pending"
+	UserCodeStatusRedeemed = "redeemed"
+	UserCodeStatusNotFound = "not_found"
+)
+
+// ErrorResponse is returned whenever a GNAP request cannot be granted.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// IntrospectRequest is the body of a POST to the introspection endpoint,
+// sent by a resource server that holds a GNAP access token.
+type IntrospectRequest struct {
+	AccessToken    string          `json:"access_token"`
+	Proof          string          `json:"proof,omitempty"`
+	ResourceServer *ClientInstance `json:"resource_server,omitempty"`
+	Access         []RequestAccess `json:"access,omitempty"`
+}
+
+// IntrospectResponse is the AS's answer to an introspection request.
+type IntrospectResponse struct {
+	Active bool            `json:"active"`
+	Access []RequestAccess `json:"access,omitempty"`
+	Key    *Key            `json:"key,omitempty"`
+	Client *ClientInstance `json:"client,omitempty"`
+	Flags  []string        `json:"flags,omitempty"`
+}